@@ -0,0 +1,179 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+import (
+	"container/heap"
+	"io"
+	"time"
+)
+
+// InterfaceDescription describes a single interface that a PacketDataSource
+// may read packets from.  It's returned by InterfaceProvider, and its index
+// in that slice corresponds to the InterfaceIndex set on the CaptureInfo of
+// packets captured from that interface.
+type InterfaceDescription struct {
+	// Name is the interface's name, eg "eth0".
+	Name string
+	// Description is a human-readable description of the interface, if the
+	// source has one available.
+	Description string
+	// LinkType is the link type of packets captured on this interface.  It
+	// must implement Decoder, since it's used to decode packets whose
+	// CaptureInfo.InterfaceIndex refers to this interface.
+	LinkType LayerType
+	// SnapLen is the maximum number of bytes captured for any given packet
+	// on this interface.
+	SnapLen uint32
+	// TimeResolution is the precision of packet timestamps on this
+	// interface.
+	TimeResolution time.Duration
+}
+
+// InterfaceProvider is implemented by PacketDataSources that can read
+// packets captured from more than one interface, such as pcapng files or
+// some live-capture mechanisms.  PacketSource queries Interfaces once, at
+// construction time, and uses the result to route each packet's
+// CaptureInfo.InterfaceIndex to the Decoder for that interface's LinkType.
+type InterfaceProvider interface {
+	// Interfaces returns the set of interfaces this source may read packets
+	// from.  A packet's CaptureInfo.InterfaceIndex is an index into this
+	// slice.
+	Interfaces() []InterfaceDescription
+}
+
+// MergePacketSources returns a new PacketSource that time-orders packets
+// read from each of the given sources, using CaptureInfo.Timestamp, so
+// captures that were split across multiple interfaces or files can be
+// replayed back in the order they actually occurred.  Each input source
+// keeps its own Decoder (or, for sources with per-interface decoders of
+// their own, all of its Decoders); the returned PacketSource's
+// CaptureInfo.InterfaceIndex values are renumbered to be unique across all
+// of sources, and routed back to whichever Decoder originally owned that
+// interface.
+//
+// The returned PacketSource uses sources[0]'s DecodeOptions.
+func MergePacketSources(sources ...*PacketSource) *PacketSource {
+	merged := &mergedPacketDataSource{}
+	p := &PacketSource{
+		source:            merged,
+		interfaceDecoders: make(map[int]Decoder),
+	}
+	if len(sources) > 0 {
+		p.decoder = sources[0].decoder
+		p.DecodeOptions = sources[0].DecodeOptions
+	}
+	for _, s := range sources {
+		entry := &mergeEntry{source: s.source, indexMap: make(map[int]int)}
+		if s.interfaceDecoders != nil {
+			// s is itself a multi-interface source: give each of its
+			// interfaces its own slot in the merged index space, so its
+			// per-interface routing survives the merge.
+			for origIndex, dec := range s.interfaceDecoders {
+				mergedIndex := len(p.interfaceDecoders)
+				p.interfaceDecoders[mergedIndex] = dec
+				entry.indexMap[origIndex] = mergedIndex
+			}
+		} else {
+			entry.defaultIndex = len(p.interfaceDecoders)
+			p.interfaceDecoders[entry.defaultIndex] = s.decoder
+		}
+		merged.entries = append(merged.entries, entry)
+	}
+	return p
+}
+
+// mergeEntry tracks one input source's next not-yet-returned packet while
+// merging.
+type mergeEntry struct {
+	source PacketDataSource
+	// indexMap remaps this source's own CaptureInfo.InterfaceIndex values
+	// to the merged PacketSource's InterfaceIndex space, so a source that's
+	// itself multi-interface keeps each of its interfaces routed to the
+	// right Decoder after merging.
+	indexMap map[int]int
+	// defaultIndex is the merged InterfaceIndex to use when indexMap has no
+	// entry for a packet's original index, which is always the case for
+	// single-interface sources (whose packets all carry InterfaceIndex 0).
+	defaultIndex int
+	data         []byte
+	ci           CaptureInfo
+}
+
+// mergedPacketDataSource is a PacketDataSource that merges packets from a
+// set of other PacketDataSources in Timestamp order, using a min-heap keyed
+// on each source's next available packet.
+type mergedPacketDataSource struct {
+	entries []*mergeEntry
+	started bool
+}
+
+// ReadPacketData implements PacketDataSource by returning the
+// earliest-timestamped packet among all not-yet-exhausted input sources.
+func (m *mergedPacketDataSource) ReadPacketData() (data []byte, ci CaptureInfo, err error) {
+	if !m.started {
+		m.started = true
+		live := m.entries[:0]
+		for _, e := range m.entries {
+			if e.fill() {
+				live = append(live, e)
+			}
+		}
+		m.entries = live
+		heap.Init((*mergeHeap)(&m.entries))
+	}
+	if len(m.entries) == 0 {
+		return nil, CaptureInfo{}, io.EOF
+	}
+	next := m.entries[0]
+	data, ci = next.data, next.ci
+	if mergedIndex, ok := next.indexMap[ci.InterfaceIndex]; ok {
+		ci.InterfaceIndex = mergedIndex
+	} else {
+		ci.InterfaceIndex = next.defaultIndex
+	}
+	if next.fill() {
+		heap.Fix((*mergeHeap)(&m.entries), 0)
+	} else {
+		heap.Pop((*mergeHeap)(&m.entries))
+	}
+	return data, ci, nil
+}
+
+// fill reads the next packet from e's source into e, returning false (and
+// leaving e untouched) once that source is exhausted.  Like
+// PacketSource.packetsToChannel, it treats io.EOF as the one terminal
+// error and silently retries on anything else, so a transient read error on
+// one source doesn't permanently drop that source from the merge.
+func (e *mergeEntry) fill() bool {
+	for {
+		data, ci, err := e.source.ReadPacketData()
+		if err == nil {
+			e.data, e.ci = data, ci
+			return true
+		}
+		if err == io.EOF {
+			return false
+		}
+	}
+}
+
+// mergeHeap implements container/heap.Interface over a slice of mergeEntry,
+// ordering entries by their next packet's Timestamp.
+type mergeHeap []*mergeEntry
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	return h[i].ci.Timestamp.Before(h[j].ci.Timestamp)
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) {
+	*h = append(*h, x.(*mergeEntry))
+}
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
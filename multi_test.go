@@ -0,0 +1,150 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// sliceSource is a PacketDataSource backed by a fixed slice of packets, each
+// optionally preceded by one transient (non-EOF) error, used to test
+// mergedPacketDataSource without needing a real capture source.
+type sliceSource struct {
+	packets    [][]byte
+	timestamps []time.Time
+	errBefore  map[int]error // index -> error to return once before that packet
+	pos        int
+}
+
+func (s *sliceSource) ReadPacketData() ([]byte, CaptureInfo, error) {
+	if e, ok := s.errBefore[s.pos]; ok {
+		delete(s.errBefore, s.pos)
+		return nil, CaptureInfo{}, e
+	}
+	if s.pos >= len(s.packets) {
+		return nil, CaptureInfo{}, io.EOF
+	}
+	data := s.packets[s.pos]
+	ts := s.timestamps[s.pos]
+	s.pos++
+	return data, CaptureInfo{Timestamp: ts}, nil
+}
+
+func at(seconds int) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+func TestMergePacketSourcesOrdersByTimestamp(t *testing.T) {
+	a := &sliceSource{
+		packets:    [][]byte{{1}, {3}},
+		timestamps: []time.Time{at(1), at(3)},
+	}
+	b := &sliceSource{
+		packets:    [][]byte{{2}, {4}},
+		timestamps: []time.Time{at(2), at(4)},
+	}
+	merged := MergePacketSources(
+		NewPacketSource(a, nil),
+		NewPacketSource(b, nil),
+	)
+
+	var got []byte
+	for {
+		data, _, err := merged.source.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, data[0])
+	}
+	want := []byte{1, 2, 3, 4}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// multiIfaceSource is a sliceSource that also implements InterfaceProvider,
+// so NewPacketSource gives it its own per-interface decoders, used to check
+// that MergePacketSources preserves that routing instead of collapsing it
+// to a single fallback Decoder.
+type multiIfaceSource struct {
+	sliceSource
+	ifaces []InterfaceDescription
+}
+
+func (s *multiIfaceSource) Interfaces() []InterfaceDescription { return s.ifaces }
+
+func TestMergePacketSourcesPreservesPerInterfaceDecoders(t *testing.T) {
+	multi := &multiIfaceSource{
+		sliceSource: sliceSource{
+			packets:    [][]byte{{1}, {2}},
+			timestamps: []time.Time{at(1), at(2)},
+		},
+		ifaces: []InterfaceDescription{
+			{Name: "eth0", LinkType: LayerType(1)},
+			{Name: "eth1", LinkType: LayerType(2)},
+		},
+	}
+
+	single := &sliceSource{
+		packets:    [][]byte{{3}},
+		timestamps: []time.Time{at(3)},
+	}
+
+	multiPS := NewPacketSource(multi, nil)
+	singlePS := NewPacketSource(single, LayerType(9))
+
+	if len(multiPS.interfaceDecoders) != 2 {
+		t.Fatalf("expected multiPS to have 2 interface decoders, got %d", len(multiPS.interfaceDecoders))
+	}
+
+	merged := MergePacketSources(multiPS, singlePS)
+
+	if len(merged.interfaceDecoders) != 3 {
+		t.Fatalf("expected merged source to carry all 3 decoders, got %d", len(merged.interfaceDecoders))
+	}
+	seen := map[Decoder]bool{}
+	for _, dec := range merged.interfaceDecoders {
+		seen[dec] = true
+	}
+	for _, want := range []Decoder{LayerType(1), LayerType(2), LayerType(9)} {
+		if !seen[want] {
+			t.Fatalf("merged.interfaceDecoders missing %v: got %v", want, merged.interfaceDecoders)
+		}
+	}
+}
+
+func TestMergePacketSourcesSurvivesTransientError(t *testing.T) {
+	flaky := errors.New("transient read error")
+	a := &sliceSource{
+		packets:    [][]byte{{1}, {2}},
+		timestamps: []time.Time{at(1), at(2)},
+		errBefore:  map[int]error{1: flaky},
+	}
+	merged := MergePacketSources(NewPacketSource(a, nil))
+
+	var got []byte
+	for i := 0; i < 2; i++ {
+		data, _, err := merged.source.ReadPacketData()
+		if err != nil {
+			t.Fatalf("unexpected error on packet %d: %v", i, err)
+		}
+		got = append(got, data[0])
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("transient error lost a packet: got %v", got)
+	}
+	if _, _, err := merged.source.ReadPacketData(); err != io.EOF {
+		t.Fatalf("expected io.EOF after exhausting source, got %v", err)
+	}
+}
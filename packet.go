@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 )
 
@@ -20,6 +21,28 @@ type CaptureInfo struct {
 	Populated             bool
 	Timestamp             time.Time
 	CaptureLength, Length int
+	// InterfaceIndex is the index, in the source's list of interfaces, of the
+	// interface this packet came in on.  This is only set by sources that
+	// support multiple interfaces, such as pcapng files or some live-capture
+	// mechanisms, and defaults to zero otherwise.
+	InterfaceIndex int
+	// AncillaryData contains extra information that a source may want to
+	// pass along with a packet, such as a VLAN tag read out-of-band by
+	// afpacket.  The contents are source-specific; most callers will never
+	// need to look at this.
+	AncillaryData []interface{}
+}
+
+// PacketMetadata contains metadata for a packet.
+type PacketMetadata struct {
+	CaptureInfo
+	// Truncated is true if packet decoding logic detects that there are fewer
+	// bytes in the packet than are detailed in various headers (for example,
+	// an IPv4 header might claim a total length of 1000 bytes, but there are
+	// only 600 bytes following it).  Such a packet is likely to have been
+	// truncated by snaplen before being recorded, rather than being damaged
+	// on the wire.
+	Truncated bool
 }
 
 // Packet is the primary object used by gopacket.  Packets are created by a
@@ -40,6 +63,10 @@ type Packet interface {
 	// a pointer to the packet's struct, so it can be used both for reading and
 	// writing the information.
 	CaptureInfo() *CaptureInfo
+	// Metadata returns the PacketMetadata for this packet.  Like CaptureInfo,
+	// this returns a pointer to the packet's struct, so it can be used both
+	// for reading and writing the information.
+	Metadata() *PacketMetadata
 
 	// LinkLayer returns the first link layer in the packet
 	LinkLayer() LinkLayer
@@ -54,6 +81,13 @@ type Packet interface {
 	// in decoding and the packet was only partially decoded.  Thus, its output
 	// can be used to determine if the entire packet was able to be decoded.
 	ErrorLayer() ErrorLayer
+	// Recycle returns a packet (including its initial layer storage) and,
+	// unless it was decoded with NoCopy, its copy of the packet data to
+	// pools of reusable packets and buffers, for use by a later call to
+	// NewPacket.  The Layer values decoded into the packet are not pooled.
+	// Once Recycle has been called, the packet and anything returned by its
+	// methods must no longer be accessed.
+	Recycle()
 }
 
 // packet contains all the information we need to fulfill the Packet interface,
@@ -63,6 +97,11 @@ type Packet interface {
 type packet struct {
 	// data contains the entire packet data for a packet
 	data []byte
+	// dataOwned is true if data was copied into a buffer we drew from
+	// dataBufferPool (see NewPacket), and so should be returned to that pool
+	// by Recycle.  It's false for NoCopy packets, whose data slice is owned
+	// by the caller and must never be reused by us.
+	dataOwned bool
 	// initialLayers is space for an initial set of layers already created inside
 	// the packet.
 	initialLayers [6]Layer
@@ -70,8 +109,8 @@ type packet struct {
 	layers []Layer
 	// last is the last layer added to the packet
 	last Layer
-	// capInfo is the CaptureInfo for this packet
-	capInfo CaptureInfo
+	// metadata is the PacketMetadata for this packet
+	metadata PacketMetadata
 
 	// Pointers to the various important layers
 	link        LinkLayer
@@ -111,11 +150,22 @@ func (p *packet) AddLayer(l Layer) {
 	p.last = l
 }
 func (p *packet) CaptureInfo() *CaptureInfo {
-	return &p.capInfo
+	return &p.metadata.CaptureInfo
+}
+func (p *packet) Metadata() *PacketMetadata {
+	return &p.metadata
 }
 func (p *packet) Data() []byte {
 	return p.data
 }
+// SetTruncated marks this packet as having been truncated, ie having less
+// data available than the various headers it's decoded so far claim should
+// be there.  It's called by layer decoders as they notice the truncation,
+// so the caller can tell a truncated packet apart from a complete one
+// without re-parsing any of its layers.
+func (p *packet) SetTruncated() {
+	p.metadata.Truncated = true
+}
 func (p *packet) recoverDecodeError() {
 	if r := recover(); r != nil {
 		fail := &DecodeFailure{err: fmt.Errorf("%v", r)}
@@ -202,6 +252,13 @@ func (p *eagerPacket) LayerClass(lc LayerClass) Layer {
 	return nil
 }
 func (p *eagerPacket) String() string { return packetString(p.Layers()) }
+func (p *eagerPacket) Recycle() {
+	if p.dataOwned {
+		putDataBuffer(p.data)
+	}
+	*p = eagerPacket{}
+	eagerPacketPool.Put(p)
+}
 
 // lazyPacket does lazy decoding on its packet data.  On construction it does
 // no initial decoding.  For each function call, it decodes only as many layers
@@ -313,6 +370,13 @@ func (p *lazyPacket) LayerClass(lc LayerClass) Layer {
 	return nil
 }
 func (p *lazyPacket) String() string { return packetString(p.Layers()) }
+func (p *lazyPacket) Recycle() {
+	if p.dataOwned {
+		putDataBuffer(p.data)
+	}
+	*p = lazyPacket{}
+	lazyPacketPool.Put(p)
+}
 
 // DecodeOptions tells gopacket how to decode a packet.
 type DecodeOptions struct {
@@ -344,20 +408,58 @@ var Lazy DecodeOptions = DecodeOptions{Lazy: true}
 // NoCopy is a DecodeOptions with just NoCopy set.
 var NoCopy DecodeOptions = DecodeOptions{NoCopy: true}
 
+// eagerPacketPool and lazyPacketPool hold recycled packets, keyed by their
+// concrete type so Recycle() can hand a packet straight back to the pool
+// NewPacket drew it from.
+var eagerPacketPool = sync.Pool{New: func() interface{} { return new(eagerPacket) }}
+var lazyPacketPool = sync.Pool{New: func() interface{} { return new(lazyPacket) }}
+
+// dataBufferPool holds recycled backing arrays for the copies NewPacket
+// makes of its input data.  The pool isn't keyed by capacity: Get returns
+// whichever buffer sync.Pool hands back, and getDataBuffer drops it if it's
+// too small for the packet at hand.  This is what actually matters for high-rate capture
+// loops: the copy is the allocation that happens on every single packet,
+// while the packet/layer structs above are comparatively rare to grow.
+var dataBufferPool = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// getDataBuffer returns a byte slice of length n, reusing a previously
+// Recycled buffer from dataBufferPool when one of sufficient capacity is
+// available, or allocating a new one otherwise.
+func getDataBuffer(n int) []byte {
+	bufp := dataBufferPool.Get().(*[]byte)
+	buf := *bufp
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// putDataBuffer returns a data buffer (as handed out by getDataBuffer) to
+// the pool, for reuse by a later call to getDataBuffer.
+func putDataBuffer(b []byte) {
+	dataBufferPool.Put(&b)
+}
+
 // NewPacket creates a new Packet object from a set of bytes.  The
 // firstLayerDecoder tells it how to interpret the first layer from the bytes,
 // future layers will be generated from that first layer automatically.
+//
+// Internally, the returned Packet is drawn from a pool of previously
+// recycled packets, and (unless NoCopy is set) its copy of data is drawn
+// from a pool of recycled data buffers (see Packet.Recycle), to reduce
+// allocations in high-throughput capture loops; calling Recycle on the
+// returned Packet once you're done with it returns both to their pools.
 func NewPacket(data []byte, firstLayerDecoder Decoder, options DecodeOptions) Packet {
-	if !options.NoCopy {
-		dataCopy := make([]byte, len(data))
+	dataOwned := !options.NoCopy
+	if dataOwned {
+		dataCopy := getDataBuffer(len(data))
 		copy(dataCopy, data)
 		data = dataCopy
 	}
 	if options.Lazy {
-		p := &lazyPacket{
-			packet: packet{data: data},
-			next:   firstLayerDecoder,
-		}
+		p := lazyPacketPool.Get().(*lazyPacket)
+		p.packet = packet{data: data, dataOwned: dataOwned}
+		p.next = firstLayerDecoder
 		p.layers = p.initialLayers[:0]
 		// Crazy craziness:
 		// If the following return statemet is REMOVED, and Lazy is FALSE, then
@@ -371,9 +473,8 @@ func NewPacket(data []byte, firstLayerDecoder Decoder, options DecodeOptions) Pa
 		// to live with slower packet processing.
 		return p
 	}
-	p := &eagerPacket{
-		packet: packet{data: data},
-	}
+	p := eagerPacketPool.Get().(*eagerPacket)
+	p.packet = packet{data: data, dataOwned: dataOwned}
 	p.layers = p.initialLayers[:0]
 	p.initialDecode(firstLayerDecoder)
 	return p
@@ -394,6 +495,22 @@ type PacketDataSource interface {
 	ReadPacketData() (data []byte, ci CaptureInfo, err error)
 }
 
+// ZeroCopyPacketDataSource is an interface to be implemented by packet data
+// sources that can handle returning data without copying it to new
+// storage.  Data returned by ZeroCopyReadPacketData is only valid until the
+// next call to ZeroCopyReadPacketData, since the source is free to reuse the
+// underlying buffer to avoid the allocation a copying implementation would
+// otherwise need.  PacketSource uses a source's ZeroCopyReadPacketData in
+// place of ReadPacketData when both NoCopy and this interface are set, since
+// NoCopy already requires the caller to guarantee the bytes won't be
+// invalidated by later packets.
+type ZeroCopyPacketDataSource interface {
+	// ZeroCopyReadPacketData returns the next packet available from this
+	// data source.  The returned data is only valid until the next call to
+	// ZeroCopyReadPacketData.
+	ZeroCopyReadPacketData() (data []byte, ci CaptureInfo, err error)
+}
+
 // PacketSource reads in packets from a PacketDataSource, decodes them, and
 // returns them.
 //
@@ -432,28 +549,63 @@ type PacketDataSource interface {
 type PacketSource struct {
 	source  PacketDataSource
 	decoder Decoder
+	// zeroCopySource is source, type-asserted to ZeroCopyPacketDataSource,
+	// or nil if source doesn't implement it.
+	zeroCopySource ZeroCopyPacketDataSource
+	// interfaceDecoders maps CaptureInfo.InterfaceIndex to the Decoder that
+	// should be used for packets read from that interface, for sources that
+	// implement InterfaceProvider.  It's nil for single-interface sources,
+	// in which case decoder is used for every packet.
+	interfaceDecoders map[int]Decoder
 	// DecodeOptions is the set of options to use for decoding each piece
 	// of packet data.  This can/should be changed by the user to reflect the
 	// way packets should be decoded.
 	DecodeOptions
 }
 
-// NewPacketSource creates a packet data source.  
+// NewPacketSource creates a packet data source.
 func NewPacketSource(source PacketDataSource, decoder Decoder) *PacketSource {
-	return &PacketSource{
-		source:  source,
-		decoder: decoder,
+	zeroCopySource, _ := source.(ZeroCopyPacketDataSource)
+	p := &PacketSource{
+		source:         source,
+		decoder:        decoder,
+		zeroCopySource: zeroCopySource,
+	}
+	if provider, ok := source.(InterfaceProvider); ok {
+		ifaces := provider.Interfaces()
+		p.interfaceDecoders = make(map[int]Decoder, len(ifaces))
+		for i, iface := range ifaces {
+			p.interfaceDecoders[i] = iface.LinkType
+		}
+	}
+	return p
+}
+
+// decoderFor returns the Decoder that should be used to decode a packet
+// captured with the given CaptureInfo, taking InterfaceIndex into account
+// for sources with per-interface decoders.
+func (p *PacketSource) decoderFor(ci CaptureInfo) Decoder {
+	if dec, ok := p.interfaceDecoders[ci.InterfaceIndex]; ok {
+		return dec
 	}
+	return p.decoder
 }
 
 // NextPacket returns the next decoded packet from the PacketSource.  On error,
 // it returns a nil packet and a non-nil error.
 func (p *PacketSource) NextPacket() (Packet, error) {
-	data, ci, err := p.source.ReadPacketData()
+	var data []byte
+	var ci CaptureInfo
+	var err error
+	if p.NoCopy && p.zeroCopySource != nil {
+		data, ci, err = p.zeroCopySource.ZeroCopyReadPacketData()
+	} else {
+		data, ci, err = p.source.ReadPacketData()
+	}
 	if err != nil {
 		return nil, err
 	}
-	packet := NewPacket(data, p.decoder, p.DecodeOptions)
+	packet := NewPacket(data, p.decoderFor(ci), p.DecodeOptions)
 	*packet.CaptureInfo() = ci
 	return packet, nil
 }
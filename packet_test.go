@@ -0,0 +1,143 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+import (
+	"io"
+	"testing"
+)
+
+// fakeDecoder is a Decoder that records whether it was invoked, so tests can
+// assert which of several candidate Decoders NextPacket actually picked.
+type fakeDecoder struct {
+	called bool
+}
+
+func (d *fakeDecoder) Decode(data []byte, p PacketBuilder) error {
+	d.called = true
+	return nil
+}
+
+// fakeZeroCopySource is a PacketDataSource that also implements
+// ZeroCopyPacketDataSource, recording which of the two read methods was
+// used to fetch each packet.
+type fakeZeroCopySource struct {
+	data          [][]byte
+	infos         []CaptureInfo
+	idx           int
+	regularCalls  int
+	zeroCopyCalls int
+}
+
+func (s *fakeZeroCopySource) ReadPacketData() ([]byte, CaptureInfo, error) {
+	s.regularCalls++
+	return s.next()
+}
+
+func (s *fakeZeroCopySource) ZeroCopyReadPacketData() ([]byte, CaptureInfo, error) {
+	s.zeroCopyCalls++
+	return s.next()
+}
+
+func (s *fakeZeroCopySource) next() ([]byte, CaptureInfo, error) {
+	if s.idx >= len(s.data) {
+		return nil, CaptureInfo{}, io.EOF
+	}
+	data, ci := s.data[s.idx], s.infos[s.idx]
+	s.idx++
+	return data, ci, nil
+}
+
+func TestNextPacketUsesZeroCopyReadWhenNoCopySet(t *testing.T) {
+	src := &fakeZeroCopySource{data: [][]byte{{1, 2, 3}}, infos: []CaptureInfo{{}}}
+	dec := &fakeDecoder{}
+	p := &PacketSource{source: src, decoder: dec, zeroCopySource: src}
+	p.NoCopy = true
+
+	if _, err := p.NextPacket(); err != nil {
+		t.Fatal(err)
+	}
+	if src.zeroCopyCalls != 1 || src.regularCalls != 0 {
+		t.Fatalf("got zeroCopyCalls=%d regularCalls=%d, want 1/0", src.zeroCopyCalls, src.regularCalls)
+	}
+}
+
+func TestNextPacketUsesRegularReadWhenNoCopyUnset(t *testing.T) {
+	src := &fakeZeroCopySource{data: [][]byte{{1, 2, 3}}, infos: []CaptureInfo{{}}}
+	dec := &fakeDecoder{}
+	p := &PacketSource{source: src, decoder: dec, zeroCopySource: src}
+
+	if _, err := p.NextPacket(); err != nil {
+		t.Fatal(err)
+	}
+	if src.regularCalls != 1 || src.zeroCopyCalls != 0 {
+		t.Fatalf("got regularCalls=%d zeroCopyCalls=%d, want 1/0", src.regularCalls, src.zeroCopyCalls)
+	}
+}
+
+func TestNextPacketRoutesToPerInterfaceDecoder(t *testing.T) {
+	src := &fakeZeroCopySource{
+		data: [][]byte{{1}, {2}, {3}},
+		infos: []CaptureInfo{
+			{InterfaceIndex: 0},
+			{InterfaceIndex: 1},
+			{InterfaceIndex: 99}, // no entry in interfaceDecoders: falls back to decoder
+		},
+	}
+	iface0, iface1, fallback := &fakeDecoder{}, &fakeDecoder{}, &fakeDecoder{}
+	p := &PacketSource{
+		source:            src,
+		decoder:           fallback,
+		interfaceDecoders: map[int]Decoder{0: iface0, 1: iface1},
+	}
+
+	for _, want := range []*fakeDecoder{iface0, iface1, fallback} {
+		if _, err := p.NextPacket(); err != nil {
+			t.Fatal(err)
+		}
+		if !want.called {
+			t.Fatalf("expected decoder %p to be used, but it was not called", want)
+		}
+		for _, dec := range []*fakeDecoder{iface0, iface1, fallback} {
+			if dec != want && dec.called {
+				t.Fatalf("decoder %p was called when %p should have been used", dec, want)
+			}
+		}
+		want.called = false
+	}
+}
+
+func TestSetTruncatedDirectly(t *testing.T) {
+	p := &packet{}
+	p.SetTruncated()
+	if !p.metadata.Truncated {
+		t.Fatal("SetTruncated did not set metadata.Truncated")
+	}
+}
+
+func TestDataBufferPoolReusesCapacity(t *testing.T) {
+	buf := getDataBuffer(64)
+	if len(buf) != 64 {
+		t.Fatalf("got len %d, want 64", len(buf))
+	}
+	buf[0] = 0xff
+	putDataBuffer(buf)
+
+	reused := getDataBuffer(32)
+	if len(reused) != 32 {
+		t.Fatalf("got len %d, want 32", len(reused))
+	}
+	if &reused[:cap(reused)][0] != &buf[:cap(buf)][0] {
+		t.Fatal("getDataBuffer did not reuse the buffer returned by putDataBuffer")
+	}
+}
+
+func TestDataBufferPoolGrowsWhenTooSmall(t *testing.T) {
+	small := getDataBuffer(4)
+	putDataBuffer(small)
+
+	bigger := getDataBuffer(4096)
+	if len(bigger) != 4096 {
+		t.Fatalf("got len %d, want 4096", len(bigger))
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+// DecodingLayer is an interface for layers that can decode themselves in
+// place, instead of allocating a new struct every time they're decoded, the
+// way that Decoder implementations traditionally do.  A single DecodingLayer
+// is meant to be reused repeatedly to decode many different packets,
+// avoiding unnecessary allocation.
+type DecodingLayer interface {
+	// DecodeFromBytes resets the internal state of this layer to contain the
+	// data passed in, so that the layer's other functions can return
+	// information based on this new data.
+	DecodeFromBytes(data []byte, df DecodeFeedback) error
+	// CanDecode returns the set of LayerType's that this DecodingLayer can
+	// decode.
+	CanDecode() LayerClass
+	// NextLayerType returns the LayerType which should be used to decode the
+	// LayerPayload.
+	NextLayerType() LayerType
+	// LayerPayload is the set of bytes remaining to decode after this layer
+	// has decoded its own bytes.
+	LayerPayload() []byte
+}
+
+// DecodeFeedback is used by DecodingLayer layers to report anomalous decoding
+// issues, such as truncated bytes, detected in the decoding process.  Unlike
+// with the Decoder/PacketBuilder interfaces, this feedback is only
+// about the current layer, so there's no need to pass along information
+// about additional layers decoded.
+type DecodeFeedback interface {
+	// SetTruncated should be called if during decoding you notice that
+	// the bytes you're handling are incomplete, due to a snaplen during
+	// capture or otherwise.
+	SetTruncated()
+}
+
+type nilDecodeFeedback struct{}
+
+func (nilDecodeFeedback) SetTruncated() {}
+
+// NilDecodeFeedback implements DecodeFeedback by doing nothing.
+var NilDecodeFeedback DecodeFeedback = nilDecodeFeedback{}
+
+// DecodingLayerParser parses a given set of layer types.  It is fast, because
+// each DecodingLayer is decoded in place, reusing the same DecodingLayer
+// structs across calls to DecodeLayers instead of allocating a new Packet
+// (and thus new Layers) for every call.  This means that DecodingLayerParser
+// is not safe for concurrent use, since the same DecodingLayers are reused
+// on every call, but it's very fast, useful in situations where you're
+// decoding a whole lot of packets and don't need to keep them all around.
+type DecodingLayerParser struct {
+	// First is the first layer type decoded by the parser, used to
+	// pick the first decoder.
+	First LayerType
+	// Truncated is set to true if any of the DecodingLayers decoded by the
+	// most recent call to DecodeLayers reported truncated data, via
+	// SetTruncated.
+	Truncated bool
+	decoders  map[LayerType]DecodingLayer
+}
+
+// NewDecodingLayerParser creates a new DecodingLayerParser, calling
+// AddDecodingLayer for each passed-in DecodingLayer.
+//  func main() {
+//    var eth layers.Ethernet
+//    var ip4 layers.IPv4
+//    var ip6 layers.IPv6
+//    var tcp layers.TCP
+//    var udp layers.UDP
+//
+//    parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &eth, &ip4, &ip6, &tcp, &udp)
+//    decoded := []gopacket.LayerType{}
+//
+//    for packetData := range somehowGetPacketData() {
+//      err := parser.DecodeLayers(packetData, &decoded)
+//      for _, layerType := range decoded {
+//        switch layerType {
+//        case layers.LayerTypeIPv6:
+//          fmt.Println("    IP6 ", ip6.SrcIP, ip6.DstIP)
+//        case layers.LayerTypeIPv4:
+//          fmt.Println("    IP4 ", ip4.SrcIP, ip4.DstIP)
+//        }
+//      }
+//    }
+//  }
+// Since it's reusing the same layers over and over, DecodingLayerParser
+// isn't safe for concurrency.  Use multiple parsers if you need concurrency.
+func NewDecodingLayerParser(first LayerType, decoders ...DecodingLayer) *DecodingLayerParser {
+	p := &DecodingLayerParser{
+		First:    first,
+		decoders: make(map[LayerType]DecodingLayer, len(decoders)),
+	}
+	for _, d := range decoders {
+		p.AddDecodingLayer(d)
+	}
+	return p
+}
+
+// AddDecodingLayer adds a decoding layer to the parser, registering it for
+// each LayerType in its CanDecode LayerClass.
+func (p *DecodingLayerParser) AddDecodingLayer(d DecodingLayer) {
+	types := d.CanDecode()
+	for _, t := range types.LayerTypes() {
+		p.decoders[t] = d
+	}
+}
+
+// DecodeLayers decodes the given packet data into the given set of
+// DecodingLayer objects passed into NewDecodingLayerParser, starting at
+// p.First, and moving on to subsequent layers as dictated by
+// NextLayerType/LayerPayload, until no more DecodingLayers are able to
+// decode the next layer type or there's no payload left to decode.  The
+// LayerType of every layer successfully
+// decoded is appended to *decoded, so callers can find out, in order,
+// what layers were actually decoded from a given packet's bytes.
+//
+// Since DecodeLayers doesn't allocate a Packet or any Layers, it's faster to
+// use than the usual NewPacket call, at the cost of flexibility and re-usable
+// DecodingLayers.
+func (p *DecodingLayerParser) DecodeLayers(data []byte, decoded *[]LayerType) (err error) {
+	*decoded = (*decoded)[:0]
+	p.Truncated = false
+	typ := p.First
+	for len(data) > 0 {
+		decoder, ok := p.decoders[typ]
+		if !ok {
+			return nil
+		}
+		if err = decoder.DecodeFromBytes(data, p); err != nil {
+			return err
+		}
+		*decoded = append(*decoded, typ)
+		typ = decoder.NextLayerType()
+		data = decoder.LayerPayload()
+	}
+	return nil
+}
+
+// SetTruncated implements DecodeFeedback, so a DecodingLayerParser can be
+// passed directly as the DecodeFeedback for each of its DecodingLayers.
+// After a call to DecodeLayers, Truncated will be true if any of the
+// decoded layers reported truncation.
+func (p *DecodingLayerParser) SetTruncated() {
+	p.Truncated = true
+}
@@ -0,0 +1,112 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeDecodingLayer is a minimal DecodingLayer used to exercise
+// DecodingLayerParser without a real layer implementation.  LayerType
+// itself is used as its own LayerClass (it's expected to satisfy
+// Contains/LayerTypes against itself), matching the convention
+// AddDecodingLayer relies on.
+type fakeDecodingLayer struct {
+	typ       LayerType
+	next      LayerType
+	payload   []byte
+	truncated bool
+	err       error
+}
+
+func (f *fakeDecodingLayer) DecodeFromBytes(data []byte, df DecodeFeedback) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.truncated {
+		df.SetTruncated()
+	}
+	return nil
+}
+func (f *fakeDecodingLayer) CanDecode() LayerClass     { return f.typ }
+func (f *fakeDecodingLayer) NextLayerType() LayerType  { return f.next }
+func (f *fakeDecodingLayer) LayerPayload() []byte      { return f.payload }
+
+const (
+	testLayerTypeA LayerType = iota + 1
+	testLayerTypeB
+	testLayerTypeC
+	// testLayerTypeNone has no registered DecodingLayer, so it terminates
+	// DecodeLayers.
+	testLayerTypeNone
+)
+
+func TestDecodeLayersAdvancesThroughNextLayerType(t *testing.T) {
+	a := &fakeDecodingLayer{typ: testLayerTypeA, next: testLayerTypeB, payload: []byte{1}}
+	b := &fakeDecodingLayer{typ: testLayerTypeB, next: testLayerTypeC, payload: []byte{2}}
+	c := &fakeDecodingLayer{typ: testLayerTypeC, next: testLayerTypeNone, payload: nil}
+
+	parser := NewDecodingLayerParser(testLayerTypeA, a, b, c)
+
+	var decoded []LayerType
+	if err := parser.DecodeLayers([]byte{0xff}, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	want := []LayerType{testLayerTypeA, testLayerTypeB, testLayerTypeC}
+	if len(decoded) != len(want) {
+		t.Fatalf("got %v, want %v", decoded, want)
+	}
+	for i := range want {
+		if decoded[i] != want[i] {
+			t.Fatalf("got %v, want %v", decoded, want)
+		}
+	}
+}
+
+func TestDecodeLayersStopsWhenNoDecoderMatches(t *testing.T) {
+	a := &fakeDecodingLayer{typ: testLayerTypeA, next: testLayerTypeNone, payload: []byte{1}}
+	parser := NewDecodingLayerParser(testLayerTypeA, a)
+
+	var decoded []LayerType
+	if err := parser.DecodeLayers([]byte{0xff}, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0] != testLayerTypeA {
+		t.Fatalf("got %v, want [%v]", decoded, testLayerTypeA)
+	}
+}
+
+func TestDecodeLayersReturnsDecodeError(t *testing.T) {
+	wantErr := errors.New("fakeDecodingLayer decode error")
+	a := &fakeDecodingLayer{typ: testLayerTypeA, err: wantErr}
+	parser := NewDecodingLayerParser(testLayerTypeA, a)
+
+	var decoded []LayerType
+	if err := parser.DecodeLayers([]byte{0xff}, &decoded); err != wantErr {
+		t.Fatalf("got err %v, want %v", err, wantErr)
+	}
+}
+
+func TestDecodeLayersSetsTruncatedFromDecodeFeedback(t *testing.T) {
+	a := &fakeDecodingLayer{typ: testLayerTypeA, next: testLayerTypeB, payload: []byte{1}, truncated: true}
+	b := &fakeDecodingLayer{typ: testLayerTypeB, next: testLayerTypeNone}
+	parser := NewDecodingLayerParser(testLayerTypeA, a, b)
+
+	var decoded []LayerType
+	if err := parser.DecodeLayers([]byte{0xff}, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !parser.Truncated {
+		t.Fatal("expected parser.Truncated to be true after a layer called SetTruncated")
+	}
+
+	// A subsequent call with no truncation should reset Truncated to false.
+	a.truncated = false
+	if err := parser.DecodeLayers([]byte{0xff}, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if parser.Truncated {
+		t.Fatal("expected parser.Truncated to reset to false on a clean decode")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+import (
+	"errors"
+)
+
+// SerializableLayer allows its implementations to be written out as a set of
+// bytes, so those bytes may be passed around (for writing to sockets,
+// files, etc) or even re-parsed back into their original layer structures.
+//
+// SerializableLayer is implemented by most of the base layer types, and
+// can be used to serialize most packets back into the wire format (though it
+// doesn't yet implement all layers/decoders).
+type SerializableLayer interface {
+	// SerializeTo writes this layer to a slice, growing that slice if
+	// necessary to make it fit the layer's data.
+	//  Args:
+	//   b: SerializeBuffer to write this layer on to.  When called, b.Bytes()
+	//     is the payload this layer should wrap, if any.  Note that this
+	//     layer can either prepend itself (common), append itself
+	//     (uncommon, but sometimes correct), or both (footers, etc).
+	//     When this call returns, b.Bytes() should return the byte
+	//     encoding of this layer wrapping the original b.Bytes() payload.
+	//   opts: options to use while writing out data.
+	// Returns an error if the layer's data cannot be properly encoded into
+	// bytes.
+	SerializeTo(b SerializeBuffer, opts SerializeOptions) error
+	// LayerType returns the type of the layer that was serialized.
+	LayerType() LayerType
+}
+
+// SerializeOptions provides options for behaviors that SerializableLayers may
+// want to implement.
+type SerializeOptions struct {
+	// FixLengths determines whether, during serialization, layers should fix
+	// the values for any length field that depends on the payload.
+	FixLengths bool
+	// ComputeChecksums determines whether, during serialization, layers
+	// should recompute checksums based on their payloads.
+	ComputeChecksums bool
+}
+
+// SerializeBuffer is a helper used by gopacket for writing out packet layers.
+// SerializeBuffer is written to from layers outward, and thus has internal
+// storage for both the current bytes of the packet, already serialized, and
+// extra space at the front and back for prepending/appending additional
+// layers as serialization continues.
+type SerializeBuffer interface {
+	// Bytes returns the bytes currently part of this buffer.  Bytes
+	// operates on the current, not future (in the case of PrependBytes), byte
+	// slice.
+	Bytes() []byte
+	// PrependBytes returns a set of bytes at the beginning of this buffer,
+	// growing the buffer if necessary.  Like the rest of the buffer's bytes,
+	// they're discarded by the next call to Clear.  The caller must set the
+	// returned bytes directly, and must not lose its reference to the
+	// returned slice.
+	PrependBytes(num int) ([]byte, error)
+	// AppendBytes returns a set of bytes at the end of this buffer, growing
+	// the buffer if necessary.  Like the rest of the buffer's bytes, they're
+	// discarded by the next call to Clear.  The caller must set the returned
+	// bytes directly, and must not lose its reference to the returned slice.
+	AppendBytes(num int) ([]byte, error)
+	// Clear resets the buffer to a new, empty buffer, ready to have new
+	// layers serialized into it.  After a call to Clear, the result of
+	// Bytes() will be an empty slice, but the underlying storage is kept so
+	// future serializations don't need to reallocate.
+	Clear()
+}
+
+// serializeBuffer implements SerializeBuffer.  It's a single growable buffer
+// with a movable start offset, so prepending bytes (the common case, since
+// SerializeLayers works from the innermost layer outward) doesn't require
+// copying the already-serialized bytes.
+type serializeBuffer struct {
+	data  []byte
+	start int
+}
+
+// NewSerializeBuffer creates a new instance of the default implementation of
+// the SerializeBuffer interface.
+func NewSerializeBuffer() SerializeBuffer {
+	return &serializeBuffer{}
+}
+
+func (w *serializeBuffer) Bytes() []byte {
+	return w.data[w.start:]
+}
+
+func (w *serializeBuffer) PrependBytes(num int) ([]byte, error) {
+	if num < 0 {
+		return nil, errors.New("invalid negative length")
+	}
+	if w.start < num {
+		// Not enough slack at the front of the buffer, so grow it, doubling
+		// the amount of space we reserve each time to amortize the cost of
+		// repeated prepends (the common case, since layers are serialized
+		// innermost-out).
+		toPrepend := len(w.data)
+		if toPrepend == 0 {
+			toPrepend = 1
+		}
+		for toPrepend < num {
+			toPrepend *= 2
+		}
+		length := len(w.data) - w.start
+		newData := make([]byte, length+toPrepend)
+		copy(newData[toPrepend:], w.data[w.start:])
+		w.data = newData
+		w.start = toPrepend
+	}
+	w.start -= num
+	return w.data[w.start : w.start+num], nil
+}
+
+func (w *serializeBuffer) AppendBytes(num int) ([]byte, error) {
+	if num < 0 {
+		return nil, errors.New("invalid negative length")
+	}
+	initialLength := len(w.data)
+	w.data = append(w.data, make([]byte, num)...)
+	return w.data[initialLength:], nil
+}
+
+func (w *serializeBuffer) Clear() {
+	// Stretch out to use half of the previous buffer as prepend space, since
+	// prepends are the common case for the layers we expect to serialize.
+	w.start = len(w.data) / 2
+	w.data = w.data[:w.start]
+}
+
+// SerializeLayers clears the given write buffer, then writes all layers into
+// it so they correctly wrap each other.  Note that by clearing the buffer, it
+// invalidates all slices previously returned by w's methods.
+//
+// Because SerializeLayers clears the buffer, its generally only useful
+// when you're planning to write multiple layers into the same buffer, one
+// after another.  See the documentation for SerializeBuffer for more
+// details.
+func SerializeLayers(w SerializeBuffer, opts SerializeOptions, layers ...SerializableLayer) error {
+	w.Clear()
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		err := layer.SerializeTo(w, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
@@ -0,0 +1,126 @@
+// Copyright 2012 Google, Inc. All rights reserved.
+
+package gopacket
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSerializeBufferAppendBytes(t *testing.T) {
+	w := NewSerializeBuffer()
+	b, err := w.AppendBytes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b, []byte{1, 2, 3})
+	b, err = w.AppendBytes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b, []byte{4, 5})
+	if !bytes.Equal(w.Bytes(), []byte{1, 2, 3, 4, 5}) {
+		t.Fatalf("got %v, want [1 2 3 4 5]", w.Bytes())
+	}
+}
+
+func TestSerializeBufferPrependBytes(t *testing.T) {
+	w := NewSerializeBuffer()
+	b, err := w.AppendBytes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b, []byte{3, 4})
+	b, err = w.PrependBytes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b, []byte{1, 2})
+	if !bytes.Equal(w.Bytes(), []byte{1, 2, 3, 4}) {
+		t.Fatalf("got %v, want [1 2 3 4]", w.Bytes())
+	}
+}
+
+// TestSerializeBufferPrependGrowsPastInitialCapacity exercises the growth
+// path in PrependBytes, where the buffer starts with zero slack at the
+// front and has to reallocate and shift the existing bytes.
+func TestSerializeBufferPrependGrowsPastInitialCapacity(t *testing.T) {
+	w := NewSerializeBuffer()
+	b, _ := w.AppendBytes(1)
+	b[0] = 0xff
+	for i := 0; i < 10; i++ {
+		b, err := w.PrependBytes(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[0] = byte(10 - i)
+	}
+	want := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0xff}
+	if !bytes.Equal(w.Bytes(), want) {
+		t.Fatalf("got %v, want %v", w.Bytes(), want)
+	}
+}
+
+func TestSerializeBufferClearResetsBytesButKeepsCapacity(t *testing.T) {
+	w := NewSerializeBuffer()
+	b, _ := w.AppendBytes(100)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	w.Clear()
+	if len(w.Bytes()) != 0 {
+		t.Fatalf("got len %d after Clear, want 0", len(w.Bytes()))
+	}
+	// A buffer that's been used once should be able to both prepend and
+	// append without reallocating every time, since Clear reserves half of
+	// the previous length as prepend space.
+	p, err := w.PrependBytes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &p[0] != &b[40] {
+		t.Fatal("PrependBytes after Clear reallocated instead of reusing the cleared buffer's storage")
+	}
+}
+
+func TestSerializeBufferRejectsNegativeLength(t *testing.T) {
+	w := NewSerializeBuffer()
+	if _, err := w.PrependBytes(-1); err == nil {
+		t.Fatal("expected error for negative PrependBytes length")
+	}
+	if _, err := w.AppendBytes(-1); err == nil {
+		t.Fatal("expected error for negative AppendBytes length")
+	}
+}
+
+// fakeSerializableLayer is a minimal SerializableLayer used to test
+// SerializeLayers' payload-first ordering.
+type fakeSerializableLayer struct {
+	layerType LayerType
+	b         byte
+}
+
+func (l fakeSerializableLayer) LayerType() LayerType { return l.layerType }
+func (l fakeSerializableLayer) SerializeTo(b SerializeBuffer, opts SerializeOptions) error {
+	buf, err := b.PrependBytes(1)
+	if err != nil {
+		return err
+	}
+	buf[0] = l.b
+	return nil
+}
+
+func TestSerializeLayersWritesOutermostLayerFirst(t *testing.T) {
+	w := NewSerializeBuffer()
+	err := SerializeLayers(w, SerializeOptions{},
+		fakeSerializableLayer{b: 1},
+		fakeSerializableLayer{b: 2},
+		fakeSerializableLayer{b: 3},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), []byte{1, 2, 3}) {
+		t.Fatalf("got %v, want [1 2 3]", w.Bytes())
+	}
+}